@@ -3,6 +3,7 @@
 package gobreaker
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"sync"
@@ -84,6 +85,87 @@ type Settings struct {
 	ReadyToTrip   func(counts Counts) bool
 	OnStateChange func(name string, from State, to State)
 	IsSuccessful  func(err error) bool
+	// IsTimeout 判断 ExecuteContext 返回的 err 是否应被当作超时来对待。为 nil 时默认仅识别 context.DeadlineExceeded。
+	// 被判定为超时的失败，在计入 Counts 时会按 timeoutWeight 加权，让高频超时比普通失败更容易触发熔断。
+	IsTimeout func(err error) bool
+	// CallTimeout 如果调用方传入 ExecuteContext 的 ctx 没有自带 deadline，则用这个时长包一层超时，
+	// 保护调用方不被一个本身没有超时设置的下游拖垮。<=0 表示不设置。
+	CallTimeout time.Duration
+	// OnOpen 熔断器处于 Open 状态、Execute/ExecuteContext 本应直接返回 ErrOpenState 时改为调用这个回调，
+	// 让调用方就地返回兜底值（降级响应、缓存结果等），而不必在每个调用点都写一遍判断 ErrOpenState 的样板代码。
+	// 为 nil 时行为不变，照常返回 ErrOpenState。
+	OnOpen func(name string, err error) (interface{}, error)
+	// OnHalfOpenReject 与 OnOpen 类似，但用在 HalfOpen 状态下探测请求数已达 MaxRequests、
+	// 本应返回 ErrTooManyRequests 的场景。为 nil 时行为不变，照常返回 ErrTooManyRequests。
+	OnHalfOpenReject func(name string, err error) (interface{}, error)
+	// Window 如果大于0，则在 closed 状态下，ReadyToTrip 收到的 Counts 不再是自上次清空以来的单一累积值，
+	// 而是最近 Window 时长内的滑动窗口聚合值（按 BucketCount 个桶切分，到期的桶会被懒惰地滚动清除）。
+	// 为0则保持原有行为：单一累积 Counts，按 Interval 整体清空。
+	Window time.Duration
+	// BucketCount 把 Window 切分成的桶数，例如 Window=10s、BucketCount=10 即每个桶代表1s。
+	// Window>0 而 BucketCount<=0 时，使用 defaultBucketCount。
+	BucketCount uint32
+	// Metrics 为 nil 时不产生任何开销；非 nil 时，CircuitBreaker 会在请求放行、请求结束、
+	// 状态变更、请求被拒绝时分别调用对应回调，方便接入 Prometheus 等监控系统，
+	// 而不必每个调用方都重新包一层同样的统计逻辑。
+	Metrics Metrics
+	// IsSuccessfulLatency 与 IsSuccessful 类似，但额外接收本次调用的耗时，用于表达
+	// “p99 延迟超过阈值也算失败”这类策略。非 nil 时优先于 IsSuccessful 使用，仅在 Execute/ExecuteContext
+	// 中生效（Allow/AllowContext 无法测量用户自己执行的耗时，不会调用它，成功与否仍按 IsSuccessful 或调用方传入的值判定）。
+	IsSuccessfulLatency func(err error, latency time.Duration) bool
+	// Store 为 nil 时使用进程内默认实现（即原有行为）；非 nil 时，状态、计数的读写都路由到 Store，
+	// 使多个副本可以共享同一个逻辑熔断器，而不是各自独立统计、各自独立跳闸，导致恢复中的下游被
+	// N 个副本同时打满。Store 模式下不支持 Window/BucketCount 滑动窗口，ReadyToTrip 收到的仍是
+	// 当前 generation 的累积 Counts；BackoffTimeout 同样不生效（consecutiveTrips 只在本地模式下
+	// 维护），Open 状态固定使用 Timeout——多副本下的退避需要 Store 实现自己持久化跳闸次数，
+	// 这里暂不支持。
+	Store Store
+	// BackoffTimeout 决定 Open 状态每次的持续时长，入参 consecutiveTrips 是“HalfOpen 探测失败
+	// 又弹回 Open”的连续次数（完整走完一次 HalfOpen→Closed 恢复后清零）。为 nil 时等价于
+	// `func(uint) time.Duration { return Timeout }`，即保持原有的固定超时行为。仅在未设置 Store
+	// 的本地模式下生效，Store 模式下 Open 状态固定使用 Timeout（见 Store 的说明）。
+	BackoffTimeout func(consecutiveTrips uint) time.Duration
+	// MaxTimeout 是 BackoffTimeout 的上限，<=0 表示不设上限。
+	MaxTimeout time.Duration
+}
+
+// Store 抽象了熔断器状态与计数的持久化/共享方式，便于接入 Redis 等外部存储实现跨副本共享熔断器。
+// 实现者需要保证针对同一个 name 的写操作是原子的（例如借助 Lua 脚本），否则多副本并发下状态可能失真。
+type Store interface {
+	// Load 读取 name 对应熔断器当前的状态、计数、所属周期（generation）和周期到期时间。
+	// name 不存在时，应视为初始状态，返回 StateClosed 和零值 Counts/generation/expiry。
+	Load(name string) (state State, counts Counts, generation uint64, expiry time.Time, err error)
+	// IncrementRequest 原子地校验准入条件后，将 generation 周期下的 Requests 加一：如果当前状态是
+	// StateOpen，或 StateHalfOpen 且 Requests 已经达到 maxRequests，必须连同这次校验一起原子地拒绝
+	// （返回 ErrOpenState/ErrTooManyRequests），而不是递增——否则多个副本各自 Load 判断"还没到上限"
+	// 再分别调用，会在同一个 HalfOpen 窗口里一起把探测请求放给恢复中的下游，违背 maxRequests 的本意。
+	// 如果 Store 中记录的 generation 已经与传入值不一致（说明状态已经被其他副本推进），也应返回
+	// error（非 ErrOpenState/ErrTooManyRequests），调用方会据此放弃这次计数并重新 Load 最新状态重试。
+	IncrementRequest(name string, generation uint64, maxRequests uint32) error
+	// IncrementSuccess 原子地记录一次成功：TotalSuccesses/ConsecutiveSuccesses 递增，
+	// ConsecutiveFailures 清零（Requests 只由 IncrementRequest 递增）。generation 校验同 IncrementRequest。
+	IncrementSuccess(name string, generation uint64) error
+	// IncrementFailure 原子地记录一次失败：TotalFailures/ConsecutiveFailures 递增，
+	// ConsecutiveSuccesses 清零（Requests 只由 IncrementRequest 递增）。generation 校验同 IncrementRequest。
+	IncrementFailure(name string, generation uint64) error
+	// CompareAndSetState 原子地把 name 对应熔断器从 from 状态切换到 to 状态，同时清空 Counts、
+	// generation 加一、expiry 设为 newExpiry。如果当前状态不是 from，应返回 error，调用方据此
+	// 得知状态已经被别的副本抢先切换，从而放弃这次转移、重新 Load 最新状态。
+	CompareAndSetState(name string, from State, to State, newExpiry time.Time) error
+}
+
+// Metrics 是熔断器对外暴露的可观测性钩子。CircuitBreaker 在请求生命周期的各个节点调用它，
+// 让接入 Prometheus 等监控系统的用户不必在每个调用点重新实现一遍同样的埋点代码。
+type Metrics interface {
+	// OnRequest 在一次请求被放行、即将执行前调用。
+	OnRequest(name string)
+	// OnResult 在一次请求执行结束后调用，success 由 IsSuccessful/IsSuccessfulLatency 判定，
+	// latency 为本次调用耗时（Execute/ExecuteContext 会测量并传递，Allow/AllowContext 传 0）。
+	OnResult(name string, success bool, latency time.Duration)
+	// OnStateChange 在熔断器状态发生变更时调用，与 Settings.OnStateChange 同时触发。
+	OnStateChange(name string, from State, to State)
+	// OnReject 在请求被熔断器拒绝（ErrOpenState/ErrTooManyRequests）时调用。
+	OnReject(name string, reason error)
 }
 
 // CircuitBreaker 结构体
@@ -120,8 +202,44 @@ type CircuitBreaker struct {
 	counts Counts
 	// 进入下个周期的时间（注意是绝对时间），比如当超时后，会从open状态切换到half-open状态
 	expiry time.Time
+
+	// window 滑动窗口总时长，0表示不开启滑动窗口，行为与 counts 一致
+	window time.Duration
+	// bucketCount 滑动窗口划分的桶数
+	bucketCount uint32
+	// buckets 环形的桶数组，每个桶覆盖 window/bucketCount 时长，仅在 closed 状态下参与 ReadyToTrip 的判断
+	buckets []Counts
+	// bucketIdx 当前生效的桶下标
+	bucketIdx int
+	// bucketStart 当前桶的起始时间，超过一个桶时长后懒惰滚动到下一个桶
+	bucketStart time.Time
+
+	// isTimeout 判断 ExecuteContext 的 err 是否为超时
+	isTimeout func(err error) bool
+	// callTimeout ExecuteContext 在 ctx 无 deadline 时兜底包的超时时长
+	callTimeout time.Duration
+	// onOpen/onHalfOpenReject 被拒绝请求的兜底回调
+	onOpen           func(name string, err error) (interface{}, error)
+	onHalfOpenReject func(name string, err error) (interface{}, error)
+	// metrics 可观测性钩子，nil 表示未开启
+	metrics Metrics
+	// isSuccessfulLatency Execute 中优先于 isSuccessful 使用的、带耗时的成功判定
+	isSuccessfulLatency func(err error, latency time.Duration) bool
+	// store 非 nil 时，所有状态/计数读写都路由到 store，本地的 state/counts/generation/expiry
+	// 字段不再使用
+	store Store
+	// backoffTimeout 根据 consecutiveTrips 计算 Open 状态的持续时长
+	backoffTimeout func(consecutiveTrips uint) time.Duration
+	// maxTimeout backoffTimeout 的上限，<=0 表示不设上限
+	maxTimeout time.Duration
+	// consecutiveTrips 记录“HalfOpen 探测失败又弹回 Open”的连续次数，HalfOpen→Closed 的
+	// 完整恢复会将其清零
+	consecutiveTrips uint
 }
 
+// timeoutWeight 超时失败计入 Counts 时的加权倍数，让连续超时比普通连续失败更快触发熔断。
+const timeoutWeight = 2
+
 // TwoStepCircuitBreaker 它只检查请求是否可以继续，并期望调用者使用回调在单独的步骤中报告结果。
 type TwoStepCircuitBreaker struct {
 	cb *CircuitBreaker
@@ -163,6 +281,35 @@ func NewCircuitBreaker(st Settings) *CircuitBreaker {
 	} else {
 		cb.isSuccessful = st.IsSuccessful
 	}
+
+	if st.Window > 0 {
+		cb.window = st.Window
+		if st.BucketCount == 0 {
+			cb.bucketCount = defaultBucketCount
+		} else {
+			cb.bucketCount = st.BucketCount
+		}
+		cb.buckets = make([]Counts, cb.bucketCount)
+	}
+
+	if st.IsTimeout == nil {
+		cb.isTimeout = defaultIsTimeout
+	} else {
+		cb.isTimeout = st.IsTimeout
+	}
+	cb.callTimeout = st.CallTimeout
+	cb.onOpen = st.OnOpen
+	cb.onHalfOpenReject = st.OnHalfOpenReject
+	cb.metrics = st.Metrics
+	cb.isSuccessfulLatency = st.IsSuccessfulLatency
+	cb.store = st.Store
+
+	if st.BackoffTimeout == nil {
+		cb.backoffTimeout = func(consecutiveTrips uint) time.Duration { return cb.timeout }
+	} else {
+		cb.backoffTimeout = st.BackoffTimeout
+	}
+	cb.maxTimeout = st.MaxTimeout
 	//设置
 	cb.toNewGeneration(time.Now())
 
@@ -178,6 +325,7 @@ func NewTwoStepCircuitBreaker(st Settings) *TwoStepCircuitBreaker {
 
 const defaultInterval = time.Duration(0) * time.Second
 const defaultTimeout = time.Duration(60) * time.Second
+const defaultBucketCount = 10
 
 // 默认为连续失败次数>5
 func defaultReadyToTrip(counts Counts) bool {
@@ -189,6 +337,24 @@ func defaultIsSuccessful(err error) bool {
 	return err == nil
 }
 
+//默认把 context.DeadlineExceeded 当作超时
+func defaultIsTimeout(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded)
+}
+
+// ErrorRateTrip 返回一个 ReadyToTrip，当请求数达到 minRequests 且失败率超过 threshold（如0.5即50%）时触发熔断。
+// 典型用法是配合 Settings.Window/BucketCount 使用，表达“最近窗口内至少20个请求且失败率超过50%”这类策略，
+// 而不是默认的连续失败次数。
+func ErrorRateTrip(minRequests uint32, threshold float64) func(counts Counts) bool {
+	return func(counts Counts) bool {
+		if counts.Requests < minRequests {
+			return false
+		}
+		failureRate := float64(counts.TotalFailures) / float64(counts.Requests)
+		return failureRate > threshold
+	}
+}
+
 // Name returns the name of the CircuitBreaker.
 func (cb *CircuitBreaker) Name() string {
 	return cb.name
@@ -196,6 +362,14 @@ func (cb *CircuitBreaker) Name() string {
 
 // State returns the current state of the CircuitBreaker.
 func (cb *CircuitBreaker) State() State {
+	if cb.store != nil {
+		state, _, _, err := cb.storeCurrentState(time.Now())
+		if err != nil {
+			return StateClosed
+		}
+		return state
+	}
+
 	cb.mutex.Lock()
 	defer cb.mutex.Unlock()
 
@@ -206,34 +380,158 @@ func (cb *CircuitBreaker) State() State {
 
 // Counts returns internal counters
 func (cb *CircuitBreaker) Counts() Counts {
+	if cb.store != nil {
+		_, counts, _, err := cb.storeCurrentState(time.Now())
+		if err != nil {
+			return Counts{}
+		}
+		return counts
+	}
+
 	cb.mutex.Lock()
 	defer cb.mutex.Unlock()
 
 	return cb.counts
 }
 
+// rejectFallback 根据 beforeRequest 返回的拒绝错误，挑出对应配置的兜底回调。
+func (cb *CircuitBreaker) rejectFallback(err error) (func(name string, err error) (interface{}, error), bool) {
+	switch err {
+	case ErrOpenState:
+		if cb.onOpen != nil {
+			return cb.onOpen, true
+		}
+	case ErrTooManyRequests:
+		if cb.onHalfOpenReject != nil {
+			return cb.onHalfOpenReject, true
+		}
+	}
+	return nil, false
+}
+
+// Trip 强制把熔断器切到 Open 状态，会正常触发 generation 递增和 OnStateChange，可用于运维后台的手动熔断。
+// 已经是 Open 状态时是个空操作。
+func (cb *CircuitBreaker) Trip() {
+	if cb.store != nil {
+		if state, _, _, _, err := cb.store.Load(cb.name); err == nil && state != StateOpen {
+			//Store 模式下 BackoffTimeout 不生效（见 Settings.BackoffTimeout 的说明），固定用 Timeout
+			cb.transitionStore(state, StateOpen, time.Now().Add(cb.timeout))
+		}
+		return
+	}
+
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	cb.setState(StateOpen, time.Now())
+}
+
+// Reset 强制把熔断器切回 Closed 状态，会正常触发 generation 递增和 OnStateChange，可用于运维后台的手动恢复。
+// 已经是 Closed 状态时是个空操作。运维强制 Reset 视为一次完整的手动恢复，即便是从 Open 直接跳过
+// HalfOpen 回到 Closed，也会清零 consecutiveTrips，让下次再跳闸从基础 Timeout/BackoffTimeout(0)
+// 重新算起，而不是继续沿用 Reset 之前积累的退避时长（setState 本身只在 HalfOpen->Closed 的自然
+// 恢复路径上清零）。
+func (cb *CircuitBreaker) Reset() {
+	if cb.store != nil {
+		if state, _, _, _, err := cb.store.Load(cb.name); err == nil && state != StateClosed {
+			cb.transitionStore(state, StateClosed, time.Time{})
+		}
+		return
+	}
+
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	cb.setState(StateClosed, time.Now())
+	cb.consecutiveTrips = 0
+}
+
 // Execute 主要包括三个阶段：1 请求之前的判定；2 服务的请求执行；3 请求后的状态和计数的更新
 func (cb *CircuitBreaker) Execute(req func() (interface{}, error)) (interface{}, error) {
 	//请求之前的判断，返回所属的周期
 	generation, err := cb.beforeRequest()
 	if err != nil {
+		//熔断器拒绝了本次请求，看看有没有配置兜底回调
+		if fallback, ok := cb.rejectFallback(err); ok {
+			return fallback(cb.name, err)
+		}
 		return nil, err
 	}
 
+	//请求与执行，顺便测量耗时，供 IsSuccessfulLatency 和 Metrics.OnResult 使用
+	start := time.Now()
 	defer func() {
 		//panic 的捕获
 		e := recover()
 		if e != nil {
 			//如果期间遇到panic，就会默认记为失败
-			cb.afterRequest(generation, false)
+			cb.afterRequest(generation, false, time.Since(start))
 			//还需要将 panic 传递给上层调用者
 			panic(e)
 		}
 	}()
-	//请求与执行
+
 	result, err := req()
-	//更新计数
-	cb.afterRequest(generation, cb.isSuccessful(err))
+	latency := time.Since(start)
+
+	success := cb.isSuccessful(err)
+	if cb.isSuccessfulLatency != nil {
+		success = cb.isSuccessfulLatency(err, latency)
+	}
+	//更新计数，Metrics.OnResult 由 afterRequest 统一触发
+	cb.afterRequest(generation, success, latency)
+	return result, err
+}
+
+// ExecuteContext 与 Execute 类似，但是会把 ctx 传给 req。如果 ctx 在发起请求前已经被取消/超时，
+// 直接返回 ctx.Err()，不占用熔断器的计数。如果调用方没有给 ctx 设置 deadline，且配置了
+// Settings.CallTimeout，会用 CallTimeout 包一层超时。req 返回的错误如果被 IsTimeout 判定为超时，
+// 会按 timeoutWeight 加权计入 Counts，让下游持续超时比普通失败更快地触发熔断；耗时同样会交给
+// IsSuccessfulLatency 和 Metrics.OnResult。
+func (cb *CircuitBreaker) ExecuteContext(ctx context.Context, req func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	generation, err := cb.beforeRequest()
+	if err != nil {
+		if fallback, ok := cb.rejectFallback(err); ok {
+			return fallback(cb.name, err)
+		}
+		return nil, err
+	}
+
+	if cb.callTimeout > 0 {
+		if _, ok := ctx.Deadline(); !ok {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, cb.callTimeout)
+			defer cancel()
+		}
+	}
+
+	start := time.Now()
+	defer func() {
+		//panic 的捕获
+		e := recover()
+		if e != nil {
+			cb.afterRequestWeighted(generation, false, 1, time.Since(start))
+			panic(e)
+		}
+	}()
+
+	result, err := req(ctx)
+	latency := time.Since(start)
+
+	weight := 1
+	if err != nil && cb.isTimeout(err) {
+		weight = timeoutWeight
+	}
+	success := cb.isSuccessful(err)
+	if cb.isSuccessfulLatency != nil {
+		success = cb.isSuccessfulLatency(err, latency)
+	}
+	//更新计数，Metrics.OnResult 由 afterRequestWeighted 统一触发
+	cb.afterRequestWeighted(generation, success, weight, latency)
 	return result, err
 }
 
@@ -262,35 +560,89 @@ func (tscb *TwoStepCircuitBreaker) Allow() (done func(success bool), err error)
 	}
 
 	return func(success bool) {
-		tscb.cb.afterRequest(generation, success)
+		//Allow 的调用方自行执行请求，这里测不到耗时，latency 恒为0
+		tscb.cb.afterRequest(generation, success, time.Duration(0))
+	}, nil
+}
+
+// AllowContext 与 Allow 类似，但是在 ctx 已经被取消/超时的情况下，直接返回 ctx.Err()，不占用熔断器的计数；
+// 返回的 done 回调额外接受 err，以便按 Settings.IsTimeout 对超时失败加权计数。
+func (tscb *TwoStepCircuitBreaker) AllowContext(ctx context.Context) (done func(err error), allowErr error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	generation, err := tscb.cb.beforeRequest()
+	if err != nil {
+		return nil, err
+	}
+
+	return func(err error) {
+		weight := 1
+		if err != nil && tscb.cb.isTimeout(err) {
+			weight = timeoutWeight
+		}
+		//AllowContext 的调用方自行执行请求，这里测不到耗时，latency 恒为0
+		tscb.cb.afterRequestWeighted(generation, tscb.cb.isSuccessful(err), weight, time.Duration(0))
 	}, nil
 }
 
 func (cb *CircuitBreaker) beforeRequest() (uint64, error) {
+	if cb.store != nil {
+		return cb.beforeRequestStore()
+	}
+
 	cb.mutex.Lock()
 	defer cb.mutex.Unlock()
 
 	now := time.Now()
+	//滑动窗口开启时，懒惰地把到期的桶滚动清除
+	cb.rotateBuckets(now)
 	//根据当前时间返回熔断器此时的状态state 与所处的周期generation
 	state, generation := cb.currentState(now)
 	//如果已经是开启状态了，就阻止当前请求
 	if state == StateOpen {
+		if cb.metrics != nil {
+			cb.metrics.OnReject(cb.name, ErrOpenState)
+		}
 		return generation, ErrOpenState
 	} else if state == StateHalfOpen && cb.counts.Requests >= cb.maxRequests {
 		//如果是半开启状态，且请求数已经大于最大请求数
 		//这里有一个限流的操作，是避免海量请求对处于恢复服务的影响
+		if cb.metrics != nil {
+			cb.metrics.OnReject(cb.name, ErrTooManyRequests)
+		}
 		return generation, ErrTooManyRequests
 	}
 	//统计计数
 	cb.counts.onRequest()
+	if cb.window > 0 {
+		cb.buckets[cb.bucketIdx].onRequest()
+	}
+	if cb.metrics != nil {
+		cb.metrics.OnRequest(cb.name)
+	}
 	return generation, nil
 }
 
-func (cb *CircuitBreaker) afterRequest(before uint64, success bool) {
+func (cb *CircuitBreaker) afterRequest(before uint64, success bool, latency time.Duration) {
+	cb.afterRequestWeighted(before, success, 1, latency)
+}
+
+// afterRequestWeighted 与 afterRequest 相同，但失败时按 weight 倍计入 Counts，供 ExecuteContext/AllowContext
+// 对超时类失败加权使用；weight 对成功请求没有意义，固定按1计。latency 是本次调用的耗时，测不到时传0，
+// 这里统一触发 Metrics.OnResult，让 Execute/ExecuteContext/Allow/AllowContext 都只上报一次。
+func (cb *CircuitBreaker) afterRequestWeighted(before uint64, success bool, weight int, latency time.Duration) {
+	if cb.store != nil {
+		cb.afterRequestStoreWeighted(before, success, weight, latency)
+		return
+	}
+
 	cb.mutex.Lock()
 	defer cb.mutex.Unlock()
 
 	now := time.Now()
+	cb.rotateBuckets(now)
 	//获取当前时间的熔断器所属的状态与所处的周期
 	state, generation := cb.currentState(now)
 	//如果已经不是在同一个周期，直接返回
@@ -301,15 +653,217 @@ func (cb *CircuitBreaker) afterRequest(before uint64, success bool) {
 	if success {
 		cb.onSuccess(state, now)
 	} else {
-		cb.onFailure(state, now)
+		if weight < 1 {
+			weight = 1
+		}
+		cb.onFailure(state, now, weight)
+	}
+	if cb.metrics != nil {
+		cb.metrics.OnResult(cb.name, success, latency)
+	}
+}
+
+// beforeRequestStore 是 beforeRequest 在 Settings.Store 非 nil 时走的分支，状态和计数的读写
+// 都路由到 Store，不再使用本地的 state/counts/generation/expiry 字段（因此 Store 模式下不支持
+// Window 滑动窗口，ReadyToTrip 收到的仍是当前 generation 的累积 Counts）。
+//
+// 准入判断（Open 拒绝 / HalfOpen 满载拒绝）交给 Store.IncrementRequest 和 Requests 自增一起原子
+// 完成，而不是这里先 Load Counts 判断再单独调一次 increment——两步之间的窗口期会被多个副本同时
+// 看到同一份 Requests、一起判断通过，参见 IncrementRequest 的文档。
+func (cb *CircuitBreaker) beforeRequestStore() (uint64, error) {
+	_, _, generation, err := cb.storeCurrentState(time.Now())
+	if err != nil {
+		return generation, err
+	}
+
+	if err := cb.store.IncrementRequest(cb.name, generation, cb.maxRequests); err != nil {
+		if rejectErr, ok := storeRejectErr(err); ok {
+			if cb.metrics != nil {
+				cb.metrics.OnReject(cb.name, rejectErr)
+			}
+			return generation, rejectErr
+		}
+		// IncrementRequest 失败且不是准入被原子拒绝，通常是别的副本抢先推进了 generation，是
+		// 多副本下的正常竞争，不是下游故障，不应该把 Store 的实现细节当作这次调用的错误抛给
+		// 调用方。重新 Load 一次拿最新的 generation 重试；如果这次发现是准入被拒绝，按正常拒绝
+		// 处理，否则这次计数就放弃，让请求照常放行。
+		_, _, generation, err = cb.storeCurrentState(time.Now())
+		if err != nil {
+			return generation, err
+		}
+		if err := cb.store.IncrementRequest(cb.name, generation, cb.maxRequests); err != nil {
+			if rejectErr, ok := storeRejectErr(err); ok {
+				if cb.metrics != nil {
+					cb.metrics.OnReject(cb.name, rejectErr)
+				}
+				return generation, rejectErr
+			}
+			return generation, nil
+		}
+	}
+	if cb.metrics != nil {
+		cb.metrics.OnRequest(cb.name)
+	}
+	return generation, nil
+}
+
+// storeRejectErr 判断 Store.IncrementRequest 返回的 error 是不是"准入被原子拒绝"
+// （ErrOpenState/ErrTooManyRequests），是则把对应的哨兵错误一并返回；否则（典型是 generation
+// 竞争失败）返回 ok=false，调用方应当重新 Load 后重试，而不是直接当作拒绝处理。
+func storeRejectErr(err error) (error, bool) {
+	switch {
+	case errors.Is(err, ErrOpenState):
+		return ErrOpenState, true
+	case errors.Is(err, ErrTooManyRequests):
+		return ErrTooManyRequests, true
+	default:
+		return nil, false
+	}
+}
+
+// afterRequestStoreWeighted 是 afterRequestWeighted 在 Store 模式下的分支。
+func (cb *CircuitBreaker) afterRequestStoreWeighted(before uint64, success bool, weight int, latency time.Duration) {
+	state, _, generation, err := cb.storeCurrentState(time.Now())
+	if err != nil || generation != before {
+		return
+	}
+
+	if success {
+		if err := cb.store.IncrementSuccess(cb.name, generation); err != nil {
+			return
+		}
+		if state == StateHalfOpen {
+			if _, counts, _, _, err := cb.store.Load(cb.name); err == nil && counts.ConsecutiveSuccesses >= cb.maxRequests {
+				cb.transitionStore(StateHalfOpen, StateClosed, time.Time{})
+			}
+		}
+	} else {
+		if weight < 1 {
+			weight = 1
+		}
+		for i := 0; i < weight; i++ {
+			if err := cb.store.IncrementFailure(cb.name, generation); err != nil {
+				return
+			}
+		}
+		switch state {
+		case StateClosed:
+			if _, counts, _, _, err := cb.store.Load(cb.name); err == nil && cb.readyToTrip(counts) {
+				//Store 模式下 BackoffTimeout 暂不生效（见 Settings.BackoffTimeout 的说明），固定用 Timeout
+				cb.transitionStore(StateClosed, StateOpen, time.Now().Add(cb.timeout))
+			}
+		case StateHalfOpen:
+			cb.transitionStore(StateHalfOpen, StateOpen, time.Now().Add(cb.timeout))
+		}
+	}
+
+	if cb.metrics != nil {
+		cb.metrics.OnResult(cb.name, success, latency)
 	}
 }
 
+// storeCurrentState 读取 Store 中的状态，并在 Open 超时、或 Closed 周期到期时推进到下一个状态/
+// 周期，语义上对应本地模式的 currentState+toNewGeneration。
+func (cb *CircuitBreaker) storeCurrentState(now time.Time) (State, Counts, uint64, error) {
+	state, counts, generation, expiry, err := cb.store.Load(cb.name)
+	if err != nil {
+		return state, counts, generation, err
+	}
+
+	switch state {
+	case StateClosed:
+		if cb.interval > 0 && !expiry.IsZero() && expiry.Before(now) {
+			if err := cb.store.CompareAndSetState(cb.name, StateClosed, StateClosed, now.Add(cb.interval)); err != nil {
+				return state, counts, generation, err
+			}
+			state, counts, generation, _, err = cb.store.Load(cb.name)
+			return state, counts, generation, err
+		}
+	case StateOpen:
+		if expiry.Before(now) {
+			cb.transitionStore(StateOpen, StateHalfOpen, time.Time{})
+			state, counts, generation, _, err = cb.store.Load(cb.name)
+			return state, counts, generation, err
+		}
+	}
+
+	return state, counts, generation, nil
+}
+
+// transitionStore 对 Store 做一次状态转移，成功后触发 OnStateChange/Metrics 回调，
+// 失败（例如别的副本已经抢先转移）时静默放弃，调用方会在随后的 Load 中看到最新状态。
+func (cb *CircuitBreaker) transitionStore(from, to State, newExpiry time.Time) {
+	if err := cb.store.CompareAndSetState(cb.name, from, to, newExpiry); err != nil {
+		return
+	}
+	if cb.onStateChange != nil {
+		cb.onStateChange(cb.name, from, to)
+	}
+	if cb.metrics != nil {
+		cb.metrics.OnStateChange(cb.name, from, to)
+	}
+}
+
+// rotateBuckets 把滑动窗口中已经过期的桶依次滚动清除，窗口未开启时什么也不做。
+func (cb *CircuitBreaker) rotateBuckets(now time.Time) {
+	if cb.window <= 0 {
+		return
+	}
+
+	bucketDuration := cb.window / time.Duration(cb.bucketCount)
+	if bucketDuration <= 0 {
+		return
+	}
+
+	if cb.bucketStart.IsZero() {
+		cb.bucketStart = now
+		return
+	}
+
+	elapsed := now.Sub(cb.bucketStart)
+	skip := int64(elapsed / bucketDuration)
+	if skip <= 0 {
+		return
+	}
+	//熔断器空闲了很久再来新请求时，elapsed 可能远大于 Window，没必要逐桶推进——
+	//反正超过 bucketCount 个桶早就把所有桶清空过一遍了，直接当作整窗清空，并把 bucketStart
+	//对齐到 now，避免下次还要算一遍同样大的 elapsed
+	if skip > int64(cb.bucketCount) {
+		for i := range cb.buckets {
+			cb.buckets[i].clear()
+		}
+		cb.bucketStart = now
+		return
+	}
+	for i := int64(0); i < skip; i++ {
+		cb.bucketIdx = (cb.bucketIdx + 1) % int(cb.bucketCount)
+		cb.buckets[cb.bucketIdx].clear()
+	}
+	cb.bucketStart = cb.bucketStart.Add(time.Duration(skip) * bucketDuration)
+}
+
+// windowCounts 汇总滑动窗口内所有存活桶的 Counts，供 ReadyToTrip 在 closed 状态下使用。
+// ConsecutiveSuccesses/ConsecutiveFailures 取自当前桶，跨桶边界的连续计数不做拼接。
+func (cb *CircuitBreaker) windowCounts() Counts {
+	var agg Counts
+	for i := range cb.buckets {
+		agg.Requests += cb.buckets[i].Requests
+		agg.TotalSuccesses += cb.buckets[i].TotalSuccesses
+		agg.TotalFailures += cb.buckets[i].TotalFailures
+	}
+	agg.ConsecutiveSuccesses = cb.buckets[cb.bucketIdx].ConsecutiveSuccesses
+	agg.ConsecutiveFailures = cb.buckets[cb.bucketIdx].ConsecutiveFailures
+	return agg
+}
+
 func (cb *CircuitBreaker) onSuccess(state State, now time.Time) {
 	switch state {
 	case StateClosed:
 		//如果熔断器是关闭的，更新成功请求次数
 		cb.counts.onSuccess()
+		if cb.window > 0 {
+			cb.buckets[cb.bucketIdx].onSuccess()
+		}
 	case StateHalfOpen:
 		//如果熔断器是半开启的，更新成功请求次数的同时，还需要判断熔断器是否需要向关闭状态过渡
 		cb.counts.onSuccess()
@@ -320,12 +874,24 @@ func (cb *CircuitBreaker) onSuccess(state State, now time.Time) {
 	}
 }
 
-func (cb *CircuitBreaker) onFailure(state State, now time.Time) {
+// onFailure weight 是这次失败计入 Counts 的加权次数（默认1，超时类失败按 timeoutWeight 加权），
+// HalfOpen 下只要有一次失败就会回到 Open，与加权无关。
+func (cb *CircuitBreaker) onFailure(state State, now time.Time, weight int) {
 	switch state {
 	case StateClosed:
 		//如果熔断器是关闭的，更新失败请求次数，还需要根据回调来判断是否需要开启熔断器
-		cb.counts.onFailure()
-		if cb.readyToTrip(cb.counts) {
+		for i := 0; i < weight; i++ {
+			cb.counts.onFailure()
+			if cb.window > 0 {
+				cb.buckets[cb.bucketIdx].onFailure()
+			}
+		}
+		//开启了滑动窗口的话，ReadyToTrip 看到的是窗口内存活桶的聚合值，而不是 Interval 累积值
+		tripCounts := cb.counts
+		if cb.window > 0 {
+			tripCounts = cb.windowCounts()
+		}
+		if cb.readyToTrip(tripCounts) {
 			cb.setState(StateOpen, now)
 		}
 	case StateHalfOpen:
@@ -357,6 +923,14 @@ func (cb *CircuitBreaker) setState(state State, now time.Time) {
 	}
 
 	prev := cb.state//记录前一个状态
+	switch {
+	case state == StateOpen && prev == StateHalfOpen:
+		//HalfOpen 探测失败又弹回 Open，视为一次新的连续跳闸，供 BackoffTimeout 逐步拉长 Open 时长
+		cb.consecutiveTrips++
+	case state == StateClosed && prev == StateHalfOpen:
+		//完整走完一次 HalfOpen -> Closed 的恢复，清零跳闸计数，下次再跳闸从基础 Timeout 重新算起
+		cb.consecutiveTrips = 0
+	}
 	cb.state = state
 
 	cb.toNewGeneration(now)
@@ -364,12 +938,25 @@ func (cb *CircuitBreaker) setState(state State, now time.Time) {
 	if cb.onStateChange != nil {
 		cb.onStateChange(cb.name, prev, state)
 	}
+	if cb.metrics != nil {
+		cb.metrics.OnStateChange(cb.name, prev, state)
+	}
 }
 
 //通过时间，设置周期，Counts，interval，expiry
 func (cb *CircuitBreaker) toNewGeneration(now time.Time) {
 	cb.generation++
 	cb.counts.clear()
+	if cb.window > 0 {
+		//滑动窗口的桶只靠 rotateBuckets 按挂钟时间懒惰滚动，跟不上状态切换——否则熔断器从
+		//Open/HalfOpen 恢复到 Closed 后，窗口里还留着恢复之前的失败，会被刚恢复就到来的新请求
+		//立刻重新计入，造成"刚恢复就又跳闸"。这里和 counts 一样，随每次新 generation 一起清空。
+		for i := range cb.buckets {
+			cb.buckets[i].clear()
+		}
+		cb.bucketIdx = 0
+		cb.bucketStart = now
+	}
 
 	var zero time.Time
 	switch cb.state {//这里 state 默认是 0
@@ -380,7 +967,11 @@ func (cb *CircuitBreaker) toNewGeneration(now time.Time) {
 			cb.expiry = now.Add(cb.interval)
 		}
 	case StateOpen:
-		cb.expiry = now.Add(cb.timeout)
+		timeout := cb.backoffTimeout(cb.consecutiveTrips)
+		if cb.maxTimeout > 0 && timeout > cb.maxTimeout {
+			timeout = cb.maxTimeout
+		}
+		cb.expiry = now.Add(timeout)
 	default: // StateHalfOpen
 		cb.expiry = zero
 	}
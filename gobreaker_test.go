@@ -0,0 +1,703 @@
+package gobreaker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+var errBoom = errors.New("boom")
+
+func succeed(cb *CircuitBreaker) error {
+	_, err := cb.Execute(func() (interface{}, error) { return nil, nil })
+	return err
+}
+
+// fail drives one failing request through cb and reports whether the breaker rejected the
+// call outright (ErrOpenState/ErrTooManyRequests) instead of letting req run.
+func fail(cb *CircuitBreaker) error {
+	_, err := cb.Execute(func() (interface{}, error) { return nil, errBoom })
+	if err == ErrOpenState || err == ErrTooManyRequests {
+		return err
+	}
+	return nil
+}
+
+// TestSlidingWindowTripsOnRecentBucketsOnly 验证开启 Window 后，ReadyToTrip 只看窗口内存活桶的
+// 聚合 Counts：窗口外的旧失败一旦被 rotateBuckets 滚动清除，就不应该再计入是否跳闸的判断。
+func TestSlidingWindowTripsOnRecentBucketsOnly(t *testing.T) {
+	cb := NewCircuitBreaker(Settings{
+		Window:      4 * time.Second,
+		BucketCount: 4, // 每个桶 1s
+		ReadyToTrip: func(counts Counts) bool { return counts.TotalFailures >= 3 },
+	})
+
+	for i := 0; i < 2; i++ {
+		if err := fail(cb); err != nil {
+			t.Fatalf("fail() #%d returned unexpected rejection: %v", i, err)
+		}
+	}
+	if got := cb.State(); got != StateClosed {
+		t.Fatalf("state = %v, want Closed after 2 failures (ReadyToTrip needs 3)", got)
+	}
+
+	// 把桶的起点往回拨 4 个桶时长，模拟早先的 2 次失败已经滚出窗口
+	cb.mutex.Lock()
+	cb.bucketStart = cb.bucketStart.Add(-4 * time.Second)
+	cb.mutex.Unlock()
+
+	for i := 0; i < 2; i++ {
+		if err := fail(cb); err != nil {
+			t.Fatalf("fail() #%d returned unexpected rejection: %v", i, err)
+		}
+	}
+	if got := cb.State(); got != StateClosed {
+		t.Fatalf("state = %v, want Closed: old failures outside the window should not count toward ReadyToTrip", got)
+	}
+}
+
+// TestRotateBucketsSkipsForwardWhenIdle 验证空闲很久之后的 rotateBuckets 不会逐桶遍历，而是一次性
+// 把所有桶清空并把 bucketStart 对齐到 now。
+func TestRotateBucketsSkipsForwardWhenIdle(t *testing.T) {
+	cb := NewCircuitBreaker(Settings{
+		Window:      4 * time.Second,
+		BucketCount: 4,
+	})
+
+	if err := fail(cb); err != nil {
+		t.Fatalf("fail() returned unexpected rejection: %v", err)
+	}
+
+	cb.mutex.Lock()
+	staleIdx := cb.bucketIdx
+	cb.bucketStart = cb.bucketStart.Add(-1000 * time.Hour)
+	cb.mutex.Unlock()
+
+	now := time.Now()
+	cb.mutex.Lock()
+	cb.rotateBuckets(now)
+	gotStart := cb.bucketStart
+	gotIdx := cb.bucketIdx
+	for i := range cb.buckets {
+		if cb.buckets[i].Requests != 0 {
+			t.Fatalf("bucket %d still has Requests=%d after a long idle rotate", i, cb.buckets[i].Requests)
+		}
+	}
+	cb.mutex.Unlock()
+
+	if gotIdx != staleIdx {
+		t.Fatalf("bucketIdx = %d, want unchanged %d after clearing all buckets", gotIdx, staleIdx)
+	}
+	if !gotStart.Equal(now) {
+		t.Fatalf("bucketStart = %v, want realigned to now (%v)", gotStart, now)
+	}
+}
+
+// TestSlidingWindowClearsOnRecoveryFromOpen 验证 Closed -> Open -> HalfOpen -> Closed 走完一整圈后，
+// 窗口里属于跳闸之前的陈旧失败会被清空，不会让刚恢复的熔断器立刻被旧数据重新打回 Open。
+func TestSlidingWindowClearsOnRecoveryFromOpen(t *testing.T) {
+	cb := NewCircuitBreaker(Settings{
+		Window:      10 * time.Second,
+		BucketCount: 10,
+		MaxRequests: 1,
+		Timeout:     time.Millisecond,
+		ReadyToTrip: func(counts Counts) bool { return counts.TotalFailures >= 3 },
+	})
+
+	for i := 0; i < 3; i++ {
+		if err := fail(cb); err != nil {
+			t.Fatalf("fail() #%d returned unexpected rejection: %v", i, err)
+		}
+	}
+	if got := cb.State(); got != StateOpen {
+		t.Fatalf("state = %v, want Open after 3 failures", got)
+	}
+
+	// 等 Timeout 过期，进入 HalfOpen，再用一次成功的探测请求把熔断器带回 Closed
+	cb.mutex.Lock()
+	cb.expiry = time.Now().Add(-time.Millisecond)
+	cb.mutex.Unlock()
+	if err := succeed(cb); err != nil {
+		t.Fatalf("succeed() HalfOpen probe returned unexpected error: %v", err)
+	}
+	if got := cb.State(); got != StateClosed {
+		t.Fatalf("state = %v, want Closed after a successful HalfOpen probe", got)
+	}
+
+	// 只送 2 次新失败（低于 ReadyToTrip 的 3 次门槛）；如果跳闸前的 3 次旧失败还留在窗口里，
+	// 这里会被错误地立刻重新打回 Open。
+	for i := 0; i < 2; i++ {
+		if err := fail(cb); err != nil {
+			t.Fatalf("post-recovery fail() #%d returned unexpected rejection: %v", i, err)
+		}
+	}
+	if got := cb.State(); got != StateClosed {
+		t.Fatalf("state = %v, want still Closed: stale pre-trip failures must not re-trip a recovered breaker", got)
+	}
+}
+
+// TestExecuteContextRejectsAlreadyCanceledContext 验证 ctx 在发起请求前已经取消时，ExecuteContext
+// 直接返回 ctx.Err()，不占用熔断器的计数。
+func TestExecuteContextRejectsAlreadyCanceledContext(t *testing.T) {
+	cb := NewCircuitBreaker(Settings{})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	called := false
+	_, err := cb.ExecuteContext(ctx, func(ctx context.Context) (interface{}, error) {
+		called = true
+		return nil, nil
+	})
+	if err != context.Canceled {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	if called {
+		t.Fatal("req should not run once ctx is already canceled")
+	}
+	if got := cb.Counts().Requests; got != 0 {
+		t.Fatalf("Requests = %d, want 0: a pre-canceled ctx must not count as a request", got)
+	}
+}
+
+// TestExecuteContextWeightsTimeoutFailures 验证被 IsTimeout 判定为超时的失败按 timeoutWeight 加权
+// 计入 Counts：先在不会跳闸的门槛下确认一次超时记了 timeoutWeight 次失败，再确认这一权重足以
+// 比普通失败更快触发 ReadyToTrip。
+func TestExecuteContextWeightsTimeoutFailures(t *testing.T) {
+	timeoutErr := errors.New("downstream timeout")
+
+	cbCounting := NewCircuitBreaker(Settings{
+		IsTimeout:   func(err error) bool { return err == timeoutErr },
+		ReadyToTrip: func(counts Counts) bool { return counts.TotalFailures >= 100 },
+	})
+	if _, err := cbCounting.ExecuteContext(context.Background(), func(ctx context.Context) (interface{}, error) {
+		return nil, timeoutErr
+	}); err != timeoutErr {
+		t.Fatalf("err = %v, want %v", err, timeoutErr)
+	}
+	if got := cbCounting.Counts().TotalFailures; got != timeoutWeight {
+		t.Fatalf("TotalFailures = %d, want %d (timeoutWeight)", got, timeoutWeight)
+	}
+
+	cbTripping := NewCircuitBreaker(Settings{
+		IsTimeout:   func(err error) bool { return err == timeoutErr },
+		ReadyToTrip: func(counts Counts) bool { return counts.TotalFailures >= timeoutWeight },
+	})
+	if _, err := cbTripping.ExecuteContext(context.Background(), func(ctx context.Context) (interface{}, error) {
+		return nil, timeoutErr
+	}); err != timeoutErr {
+		t.Fatalf("err = %v, want %v", err, timeoutErr)
+	}
+	if got := cbTripping.State(); got != StateOpen {
+		t.Fatalf("state = %v, want Open: a single timeout weighted %d should already satisfy ReadyToTrip", got, timeoutWeight)
+	}
+}
+
+// TestExecuteContextCallTimeoutWrapsDeadlinelessContext 验证调用方传入的 ctx 没有自带 deadline
+// 时，ExecuteContext 会用 Settings.CallTimeout 包一层超时：req 一直不返回也会在约 CallTimeout 后
+// 被 ctx.Err() 判定为 context.DeadlineExceeded 打断，而不是无限期挂起。
+func TestExecuteContextCallTimeoutWrapsDeadlinelessContext(t *testing.T) {
+	cb := NewCircuitBreaker(Settings{CallTimeout: 20 * time.Millisecond})
+
+	start := time.Now()
+	_, err := cb.ExecuteContext(context.Background(), func(ctx context.Context) (interface{}, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	elapsed := time.Since(start)
+
+	if err != context.DeadlineExceeded {
+		t.Fatalf("err = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed < 20*time.Millisecond || elapsed > 200*time.Millisecond {
+		t.Fatalf("elapsed = %v, want ~= CallTimeout (20ms)", elapsed)
+	}
+}
+
+// TestExecuteContextCallTimeoutDoesNotOverrideExistingDeadline 验证调用方自己给 ctx 设置了更短的
+// deadline 时，CallTimeout 不应该覆盖它——req 应该在调用方的 deadline 而不是 CallTimeout 处被打断。
+func TestExecuteContextCallTimeoutDoesNotOverrideExistingDeadline(t *testing.T) {
+	cb := NewCircuitBreaker(Settings{CallTimeout: time.Hour})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := cb.ExecuteContext(ctx, func(ctx context.Context) (interface{}, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	elapsed := time.Since(start)
+
+	if err != context.DeadlineExceeded {
+		t.Fatalf("err = %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed > 500*time.Millisecond {
+		t.Fatalf("elapsed = %v, want ~= the caller's own deadline (20ms), not CallTimeout (1h)", elapsed)
+	}
+}
+
+// fakeStore 是一个进程内的 Store 实现，只用来在不依赖真实 Redis 的情况下，练习
+// CircuitBreaker 在 Store 模式下的 generation 竞争处理逻辑。
+type fakeStore struct {
+	state      State
+	counts     Counts
+	generation uint64
+	expiry     time.Time
+
+	// mismatchOnce 非0时，下一次 IncrementRequest 会返回一次 generation mismatch 错误，
+	// 用来模拟别的副本抢先推进了 generation 的竞争场景。
+	mismatchOnce int
+}
+
+func (s *fakeStore) Load(name string) (State, Counts, uint64, time.Time, error) {
+	return s.state, s.counts, s.generation, s.expiry, nil
+}
+
+func (s *fakeStore) IncrementRequest(name string, generation uint64, maxRequests uint32) error {
+	if s.mismatchOnce > 0 {
+		s.mismatchOnce--
+		return errors.New("generation mismatch")
+	}
+	if generation != s.generation {
+		return errors.New("generation mismatch")
+	}
+	if s.state == StateOpen {
+		return ErrOpenState
+	}
+	if s.state == StateHalfOpen && s.counts.Requests >= maxRequests {
+		return ErrTooManyRequests
+	}
+	s.counts.onRequest()
+	return nil
+}
+
+func (s *fakeStore) IncrementSuccess(name string, generation uint64) error {
+	if generation != s.generation {
+		return errors.New("generation mismatch")
+	}
+	s.counts.onSuccess()
+	return nil
+}
+
+func (s *fakeStore) IncrementFailure(name string, generation uint64) error {
+	if generation != s.generation {
+		return errors.New("generation mismatch")
+	}
+	s.counts.onFailure()
+	return nil
+}
+
+func (s *fakeStore) CompareAndSetState(name string, from, to State, newExpiry time.Time) error {
+	if s.state != from {
+		return errors.New("state mismatch")
+	}
+	s.state = to
+	s.counts.clear()
+	s.generation++
+	s.expiry = newExpiry
+	return nil
+}
+
+// TestStoreGenerationMismatchDoesNotLeakToCaller 验证 beforeRequestStore 在 IncrementRequest 因为
+// generation 竞争失败时，会重试而不是把 Store 的 "generation mismatch" 错误原样抛给 Execute 的调用方。
+func TestStoreGenerationMismatchDoesNotLeakToCaller(t *testing.T) {
+	store := &fakeStore{mismatchOnce: 1}
+	cb := NewCircuitBreaker(Settings{Store: store})
+
+	result, err := cb.Execute(func() (interface{}, error) { return "ok", nil })
+	if err != nil {
+		t.Fatalf("err = %v, want nil: a generation race must not surface as the call's error", err)
+	}
+	if result != "ok" {
+		t.Fatalf("result = %v, want \"ok\"", result)
+	}
+}
+
+// TestStoreOpenStateStillRejectsAfterMismatchRetry 验证重试时如果发现状态已经变成 Open，
+// 依旧按正常拒绝路径处理，而不是放行请求。
+func TestStoreOpenStateStillRejectsAfterMismatchRetry(t *testing.T) {
+	store := &fakeStore{mismatchOnce: 1}
+	cb := NewCircuitBreaker(Settings{Store: store})
+
+	// 重试发生前，让 Store 里的状态变成 Open
+	store.state = StateOpen
+	store.expiry = time.Now().Add(time.Minute)
+
+	_, err := cb.Execute(func() (interface{}, error) { return nil, nil })
+	if err != ErrOpenState {
+		t.Fatalf("err = %v, want ErrOpenState", err)
+	}
+}
+
+// TestBackoffTimeoutGrowsWithConsecutiveTrips 验证 HalfOpen 探测失败反复弹回 Open 时，Open 状态的
+// 持续时长按 BackoffTimeout(consecutiveTrips) 逐步拉长，且受 MaxTimeout 封顶。
+func TestBackoffTimeoutGrowsWithConsecutiveTrips(t *testing.T) {
+	var gotTrips []uint
+	cb := NewCircuitBreaker(Settings{
+		ReadyToTrip: func(counts Counts) bool { return counts.ConsecutiveFailures >= 1 },
+		BackoffTimeout: func(consecutiveTrips uint) time.Duration {
+			gotTrips = append(gotTrips, consecutiveTrips)
+			return time.Duration(consecutiveTrips+1) * time.Second
+		},
+		MaxTimeout: 2 * time.Second,
+	})
+
+	// 第一次跳闸：Closed -> Open，consecutiveTrips 还是0
+	if err := fail(cb); err != nil {
+		t.Fatalf("fail() returned unexpected rejection: %v", err)
+	}
+	if got := cb.State(); got != StateOpen {
+		t.Fatalf("state = %v, want Open after ReadyToTrip", got)
+	}
+
+	// 手动推进到 Open 的 expiry 之后，让熔断器探测式地进入 HalfOpen，再让探测失败弹回 Open
+	for i := 0; i < 3; i++ {
+		cb.mutex.Lock()
+		cb.expiry = time.Now().Add(-time.Millisecond)
+		cb.mutex.Unlock()
+
+		if err := fail(cb); err != nil {
+			t.Fatalf("fail() #%d returned unexpected rejection: %v", i, err)
+		}
+		if got := cb.State(); got != StateOpen {
+			t.Fatalf("state = %v, want Open after a failed HalfOpen probe #%d", got, i)
+		}
+	}
+
+	want := []uint{0, 1, 2, 3}
+	if len(gotTrips) != len(want) {
+		t.Fatalf("BackoffTimeout called with %v, want %v", gotTrips, want)
+	}
+	for i, w := range want {
+		if gotTrips[i] != w {
+			t.Fatalf("BackoffTimeout call #%d got consecutiveTrips=%d, want %d", i, gotTrips[i], w)
+		}
+	}
+
+	cb.mutex.Lock()
+	gotTimeout := cb.expiry.Sub(time.Now())
+	cb.mutex.Unlock()
+	// BackoffTimeout(3) would be 4s, but MaxTimeout=2s caps it.
+	if gotTimeout > 2*time.Second+500*time.Millisecond || gotTimeout < 1500*time.Millisecond {
+		t.Fatalf("Open timeout ~= %v, want capped around MaxTimeout (2s)", gotTimeout)
+	}
+}
+
+// fakeMetrics 是一个进程内的 Metrics 实现，只用来记录 CircuitBreaker 在请求生命周期各个节点
+// 调用钩子的次数和参数，验证调用时机和耗时传递是否正确。
+type fakeMetrics struct {
+	requests     []string
+	results      []fakeMetricsResult
+	rejects      []fakeMetricsReject
+	stateChanges []fakeMetricsStateChange
+}
+
+type fakeMetricsResult struct {
+	name    string
+	success bool
+	latency time.Duration
+}
+
+type fakeMetricsReject struct {
+	name   string
+	reason error
+}
+
+type fakeMetricsStateChange struct {
+	name     string
+	from, to State
+}
+
+func (m *fakeMetrics) OnRequest(name string) {
+	m.requests = append(m.requests, name)
+}
+
+func (m *fakeMetrics) OnResult(name string, success bool, latency time.Duration) {
+	m.results = append(m.results, fakeMetricsResult{name, success, latency})
+}
+
+func (m *fakeMetrics) OnStateChange(name string, from, to State) {
+	m.stateChanges = append(m.stateChanges, fakeMetricsStateChange{name, from, to})
+}
+
+func (m *fakeMetrics) OnReject(name string, reason error) {
+	m.rejects = append(m.rejects, fakeMetricsReject{name, reason})
+}
+
+// TestMetricsHooksFireOnRequestResultAndStateChange 验证 Settings.Metrics 在请求放行、请求结束、
+// 状态变更时分别被调用一次，且 OnResult 收到的是 Execute 实际测得的耗时，而不是恒为0。
+func TestMetricsHooksFireOnRequestResultAndStateChange(t *testing.T) {
+	metrics := &fakeMetrics{}
+	cb := NewCircuitBreaker(Settings{
+		Name:        "svc",
+		Metrics:     metrics,
+		ReadyToTrip: func(counts Counts) bool { return counts.ConsecutiveFailures >= 1 },
+	})
+
+	if _, err := cb.Execute(func() (interface{}, error) {
+		time.Sleep(time.Millisecond)
+		return nil, errBoom
+	}); err != errBoom {
+		t.Fatalf("Execute() error = %v, want %v", err, errBoom)
+	}
+
+	if len(metrics.requests) != 1 || metrics.requests[0] != "svc" {
+		t.Fatalf("requests = %v, want one OnRequest(\"svc\")", metrics.requests)
+	}
+	if len(metrics.results) != 1 {
+		t.Fatalf("results = %v, want one OnResult call", metrics.results)
+	}
+	if metrics.results[0].success {
+		t.Fatalf("results[0].success = true, want false: req returned errBoom")
+	}
+	if metrics.results[0].latency < time.Millisecond {
+		t.Fatalf("results[0].latency = %v, want >= 1ms: the measured Execute duration", metrics.results[0].latency)
+	}
+	if len(metrics.stateChanges) != 1 || metrics.stateChanges[0].to != StateOpen {
+		t.Fatalf("stateChanges = %v, want one transition to Open after ReadyToTrip", metrics.stateChanges)
+	}
+}
+
+// TestMetricsOnRejectFiresForOpenAndHalfOpenCap 验证熔断器在 Open 状态拒绝、以及 HalfOpen 达到
+// MaxRequests 拒绝时，都会调用 OnReject 并带上对应的哨兵错误作为 reason。
+func TestMetricsOnRejectFiresForOpenAndHalfOpenCap(t *testing.T) {
+	metrics := &fakeMetrics{}
+	cb := NewCircuitBreaker(Settings{Metrics: metrics})
+
+	cb.Trip()
+	if _, err := cb.beforeRequest(); err != ErrOpenState {
+		t.Fatalf("beforeRequest() error = %v, want ErrOpenState", err)
+	}
+
+	cb.mutex.Lock()
+	cb.expiry = time.Now().Add(-time.Millisecond) // let Open's Timeout elapse
+	cb.mutex.Unlock()
+
+	if _, err := cb.beforeRequest(); err != nil {
+		t.Fatalf("beforeRequest() error = %v, want nil: the first HalfOpen probe should be admitted", err)
+	}
+	if _, err := cb.beforeRequest(); err != ErrTooManyRequests {
+		t.Fatalf("beforeRequest() error = %v, want ErrTooManyRequests: MaxRequests (default 1) already in flight", err)
+	}
+
+	if len(metrics.rejects) != 2 {
+		t.Fatalf("rejects = %v, want 2 (one ErrOpenState, one ErrTooManyRequests)", metrics.rejects)
+	}
+	if metrics.rejects[0].reason != ErrOpenState {
+		t.Fatalf("rejects[0].reason = %v, want ErrOpenState", metrics.rejects[0].reason)
+	}
+	if metrics.rejects[1].reason != ErrTooManyRequests {
+		t.Fatalf("rejects[1].reason = %v, want ErrTooManyRequests", metrics.rejects[1].reason)
+	}
+}
+
+// TestTripFromClosedBumpsGenerationAndFiresOnStateChange 验证 Trip() 从 Closed 强制切到 Open 时，
+// 和自然跳闸一样会推进 generation、触发 OnStateChange，并让后续请求被 ErrOpenState 拒绝。
+func TestTripFromClosedBumpsGenerationAndFiresOnStateChange(t *testing.T) {
+	var changes []fakeMetricsStateChange
+	cb := NewCircuitBreaker(Settings{
+		OnStateChange: func(name string, from, to State) {
+			changes = append(changes, fakeMetricsStateChange{name, from, to})
+		},
+	})
+	generationBefore := cb.generation
+
+	cb.Trip()
+
+	if got := cb.State(); got != StateOpen {
+		t.Fatalf("state = %v, want Open", got)
+	}
+	if cb.generation == generationBefore {
+		t.Fatalf("generation = %d, want it to have advanced past %d", cb.generation, generationBefore)
+	}
+	if len(changes) != 1 || changes[0].from != StateClosed || changes[0].to != StateOpen {
+		t.Fatalf("OnStateChange calls = %v, want one Closed->Open transition", changes)
+	}
+	if _, err := cb.Execute(func() (interface{}, error) { return "ok", nil }); err != ErrOpenState {
+		t.Fatalf("Execute() error = %v, want ErrOpenState after Trip()", err)
+	}
+}
+
+// TestTripIsNoopWhenAlreadyOpen 验证已经是 Open 状态时再调用 Trip() 是个空操作：generation 不变，
+// 不会多触发一次 OnStateChange。
+func TestTripIsNoopWhenAlreadyOpen(t *testing.T) {
+	var changeCount int
+	cb := NewCircuitBreaker(Settings{
+		OnStateChange: func(name string, from, to State) { changeCount++ },
+	})
+
+	cb.Trip()
+	generationAfterFirstTrip := cb.generation
+	changeCountAfterFirstTrip := changeCount
+
+	cb.Trip()
+
+	if cb.generation != generationAfterFirstTrip {
+		t.Fatalf("generation = %d, want unchanged %d: Trip() on an already-Open breaker must be a noop", cb.generation, generationAfterFirstTrip)
+	}
+	if changeCount != changeCountAfterFirstTrip {
+		t.Fatalf("OnStateChange fired %d times, want still %d", changeCount, changeCountAfterFirstTrip)
+	}
+}
+
+// TestResetFromHalfOpenBumpsGenerationAndFiresOnStateChange 验证 Reset() 从 HalfOpen 强制切到
+// Closed 时，和探测成功的自然恢复一样会推进 generation、触发 OnStateChange。
+func TestResetFromHalfOpenBumpsGenerationAndFiresOnStateChange(t *testing.T) {
+	var changes []fakeMetricsStateChange
+	cb := NewCircuitBreaker(Settings{
+		OnStateChange: func(name string, from, to State) {
+			changes = append(changes, fakeMetricsStateChange{name, from, to})
+		},
+	})
+	cb.Trip()
+	cb.mutex.Lock()
+	cb.expiry = time.Now().Add(-time.Millisecond) // let Open's Timeout elapse
+	state, _ := cb.currentState(time.Now())
+	cb.mutex.Unlock()
+	if state != StateHalfOpen {
+		t.Fatalf("state = %v, want HalfOpen before Reset()", state)
+	}
+	generationBefore := cb.generation
+
+	cb.Reset()
+
+	if got := cb.State(); got != StateClosed {
+		t.Fatalf("state = %v, want Closed", got)
+	}
+	if cb.generation == generationBefore {
+		t.Fatalf("generation = %d, want it to have advanced past %d", cb.generation, generationBefore)
+	}
+	if len(changes) != 3 {
+		// Closed->Open (Trip), Open->HalfOpen (currentState probing), HalfOpen->Closed (Reset)
+		t.Fatalf("OnStateChange calls = %v, want 3 transitions", changes)
+	}
+	if last := changes[len(changes)-1]; last.from != StateHalfOpen || last.to != StateClosed {
+		t.Fatalf("last OnStateChange = %v, want HalfOpen->Closed", last)
+	}
+}
+
+// TestResetIsNoopWhenAlreadyClosed 验证已经是 Closed 状态时再调用 Reset() 是个空操作。
+func TestResetIsNoopWhenAlreadyClosed(t *testing.T) {
+	var changeCount int
+	cb := NewCircuitBreaker(Settings{
+		OnStateChange: func(name string, from, to State) { changeCount++ },
+	})
+	generationBefore := cb.generation
+
+	cb.Reset()
+
+	if cb.generation != generationBefore {
+		t.Fatalf("generation = %d, want unchanged %d: Reset() on an already-Closed breaker must be a noop", cb.generation, generationBefore)
+	}
+	if changeCount != 0 {
+		t.Fatalf("OnStateChange fired %d times, want 0", changeCount)
+	}
+}
+
+// TestResetFromOpenClearsConsecutiveTrips 验证运维强制 Reset() 即便是从 Open 直接跳过 HalfOpen
+// 回到 Closed，也会清零 consecutiveTrips：下一次跳闸应该从 BackoffTimeout(0) 重新算起，而不是
+// 沿用 Reset 之前积累的退避次数。
+func TestResetFromOpenClearsConsecutiveTrips(t *testing.T) {
+	var gotTrips []uint
+	cb := NewCircuitBreaker(Settings{
+		ReadyToTrip: func(counts Counts) bool { return counts.ConsecutiveFailures >= 1 },
+		BackoffTimeout: func(consecutiveTrips uint) time.Duration {
+			gotTrips = append(gotTrips, consecutiveTrips)
+			return time.Second
+		},
+	})
+
+	// 跳闸一次，再探测失败弹回 Open，让 consecutiveTrips 涨到 1
+	if err := fail(cb); err != nil {
+		t.Fatalf("fail() returned unexpected rejection: %v", err)
+	}
+	cb.mutex.Lock()
+	cb.expiry = time.Now().Add(-time.Millisecond)
+	cb.mutex.Unlock()
+	if err := fail(cb); err != nil {
+		t.Fatalf("fail() returned unexpected rejection: %v", err)
+	}
+	if cb.consecutiveTrips != 1 {
+		t.Fatalf("consecutiveTrips = %d, want 1 before Reset()", cb.consecutiveTrips)
+	}
+
+	// 运维直接从 Open 强制 Reset，而不是走 HalfOpen 探测成功的自然恢复路径
+	cb.Reset()
+	if cb.consecutiveTrips != 0 {
+		t.Fatalf("consecutiveTrips = %d after Reset(), want 0: a forced Reset is a full manual recovery", cb.consecutiveTrips)
+	}
+
+	// 下一次跳闸应该再次拿到 consecutiveTrips=0，而不是延续 Reset 之前的退避计数
+	if err := fail(cb); err != nil {
+		t.Fatalf("fail() returned unexpected rejection: %v", err)
+	}
+	if want := uint(0); gotTrips[len(gotTrips)-1] != want {
+		t.Fatalf("BackoffTimeout last called with consecutiveTrips=%d, want %d after Reset()", gotTrips[len(gotTrips)-1], want)
+	}
+}
+
+// TestOnOpenFallbackShortCircuitsExecute 验证配置了 Settings.OnOpen 时，Open 状态下 Execute 会
+// 调用这个兜底回调并返回它的结果，而不是直接把 ErrOpenState 抛给调用方。
+func TestOnOpenFallbackShortCircuitsExecute(t *testing.T) {
+	var gotName string
+	var gotErr error
+	cb := NewCircuitBreaker(Settings{
+		Name: "svc",
+		OnOpen: func(name string, err error) (interface{}, error) {
+			gotName, gotErr = name, err
+			return "fallback", nil
+		},
+	})
+	cb.Trip()
+
+	result, err := cb.Execute(func() (interface{}, error) {
+		t.Fatal("req must not run while the breaker is Open")
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatalf("err = %v, want nil: OnOpen's own return value should be used", err)
+	}
+	if result != "fallback" {
+		t.Fatalf("result = %v, want \"fallback\"", result)
+	}
+	if gotName != "svc" || gotErr != ErrOpenState {
+		t.Fatalf("OnOpen called with (%q, %v), want (\"svc\", ErrOpenState)", gotName, gotErr)
+	}
+}
+
+// TestOnHalfOpenRejectFallbackShortCircuitsExecuteContext 验证配置了 Settings.OnHalfOpenReject
+// 时，HalfOpen 且探测名额已满的 ExecuteContext 调用会走这个兜底回调，而不是直接返回
+// ErrTooManyRequests。
+func TestOnHalfOpenRejectFallbackShortCircuitsExecuteContext(t *testing.T) {
+	var gotErr error
+	cb := NewCircuitBreaker(Settings{
+		OnHalfOpenReject: func(name string, err error) (interface{}, error) {
+			gotErr = err
+			return "fallback", nil
+		},
+	})
+	cb.Trip()
+	cb.mutex.Lock()
+	cb.expiry = time.Now().Add(-time.Millisecond) // let Open's Timeout elapse
+	cb.mutex.Unlock()
+
+	// 占满 HalfOpen 唯一的探测名额（默认 MaxRequests=1）
+	if _, err := cb.beforeRequest(); err != nil {
+		t.Fatalf("beforeRequest() error = %v, want nil: the first HalfOpen probe should be admitted", err)
+	}
+
+	result, err := cb.ExecuteContext(context.Background(), func(ctx context.Context) (interface{}, error) {
+		t.Fatal("req must not run once the HalfOpen probe slot is taken")
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatalf("err = %v, want nil: OnHalfOpenReject's own return value should be used", err)
+	}
+	if result != "fallback" {
+		t.Fatalf("result = %v, want \"fallback\"", result)
+	}
+	if gotErr != ErrTooManyRequests {
+		t.Fatalf("OnHalfOpenReject called with err = %v, want ErrTooManyRequests", gotErr)
+	}
+}
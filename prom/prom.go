@@ -0,0 +1,85 @@
+// Package prom provides a gobreaker.Metrics implementation backed by
+// Prometheus, exporting per-breaker request/result/reject counters and a
+// state gauge without requiring callers to wire up the same boilerplate
+// themselves.
+package prom
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sony/gobreaker"
+)
+
+// Metrics 是 gobreaker.Metrics 的 Prometheus 实现，按熔断器 name 打标签导出
+// 请求数、结果数（成功/失败）、拒绝数（按原因）、耗时分布和当前状态 gauge。
+type Metrics struct {
+	requests *prometheus.CounterVec
+	results  *prometheus.CounterVec
+	rejects  *prometheus.CounterVec
+	latency  *prometheus.HistogramVec
+	state    *prometheus.GaugeVec
+}
+
+// NewMetrics 创建一组指标并注册到 reg；reg 为 nil 时注册到 prometheus.DefaultRegisterer。
+// 返回的 *Metrics 可以直接赋给 gobreaker.Settings.Metrics。
+func NewMetrics(reg prometheus.Registerer) *Metrics {
+	if reg == nil {
+		reg = prometheus.DefaultRegisterer
+	}
+
+	m := &Metrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gobreaker_requests_total",
+			Help: "Total number of requests allowed through the circuit breaker.",
+		}, []string{"name"}),
+		results: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gobreaker_results_total",
+			Help: "Total number of request results, labeled by outcome (success/failure).",
+		}, []string{"name", "outcome"}),
+		rejects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gobreaker_rejects_total",
+			Help: "Total number of requests rejected by the circuit breaker, labeled by reason.",
+		}, []string{"name", "reason"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "gobreaker_request_duration_seconds",
+			Help: "Latency of requests executed through the circuit breaker.",
+		}, []string{"name"}),
+		state: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gobreaker_state",
+			Help: "Current state of the circuit breaker (0=closed, 1=half-open, 2=open).",
+		}, []string{"name"}),
+	}
+
+	reg.MustRegister(m.requests, m.results, m.rejects, m.latency, m.state)
+
+	return m
+}
+
+// OnRequest implements gobreaker.Metrics.
+func (m *Metrics) OnRequest(name string) {
+	m.requests.WithLabelValues(name).Inc()
+}
+
+// OnResult implements gobreaker.Metrics.
+func (m *Metrics) OnResult(name string, success bool, latency time.Duration) {
+	m.results.WithLabelValues(name, outcomeLabel(success)).Inc()
+	m.latency.WithLabelValues(name).Observe(latency.Seconds())
+}
+
+// OnStateChange implements gobreaker.Metrics.
+func (m *Metrics) OnStateChange(name string, from, to gobreaker.State) {
+	m.state.WithLabelValues(name).Set(float64(to))
+}
+
+// OnReject implements gobreaker.Metrics.
+func (m *Metrics) OnReject(name string, reason error) {
+	m.rejects.WithLabelValues(name, reason.Error()).Inc()
+}
+
+func outcomeLabel(success bool) string {
+	if success {
+		return "success"
+	}
+	return "failure"
+}
@@ -0,0 +1,66 @@
+package prom
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sony/gobreaker"
+)
+
+// TestMetricsRecordsRequestsResultsRejectsAndState 验证 Metrics 把 CircuitBreaker 的各个回调
+// 正确地累加到对应的 Prometheus 指标上：OnRequest 累加 requests_total，OnResult 按成功/失败分别
+// 累加 results_total，OnReject 按拒绝原因累加 rejects_total，OnStateChange 把 state gauge 设为
+// 目标状态的数值。
+func TestMetricsRecordsRequestsResultsRejectsAndState(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := NewMetrics(reg)
+
+	m.OnRequest("svc")
+	m.OnRequest("svc")
+	m.OnResult("svc", true, 10*time.Millisecond)
+	m.OnResult("svc", false, 20*time.Millisecond)
+	m.OnReject("svc", gobreaker.ErrTooManyRequests)
+	m.OnStateChange("svc", gobreaker.StateClosed, gobreaker.StateOpen)
+
+	if got := testutil.ToFloat64(m.requests.WithLabelValues("svc")); got != 2 {
+		t.Fatalf("requests_total = %v, want 2", got)
+	}
+	if got := testutil.ToFloat64(m.results.WithLabelValues("svc", "success")); got != 1 {
+		t.Fatalf("results_total{outcome=success} = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(m.results.WithLabelValues("svc", "failure")); got != 1 {
+		t.Fatalf("results_total{outcome=failure} = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(m.rejects.WithLabelValues("svc", gobreaker.ErrTooManyRequests.Error())); got != 1 {
+		t.Fatalf("rejects_total{reason=%q} = %v, want 1", gobreaker.ErrTooManyRequests, got)
+	}
+	if got := testutil.ToFloat64(m.state.WithLabelValues("svc")); got != float64(gobreaker.StateOpen) {
+		t.Fatalf("state gauge = %v, want %v (StateOpen)", got, gobreaker.StateOpen)
+	}
+}
+
+// TestNewMetricsRegistersOnGivenRegisterer 验证 NewMetrics 把指标注册到传入的 reg 上，而不是
+// 悄悄落到 prometheus.DefaultRegisterer，否则多个测试/多个 CircuitBreaker 之间会互相污染彼此
+// 的指标。
+func TestNewMetricsRegistersOnGivenRegisterer(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := NewMetrics(reg)
+	m.OnRequest("svc") // instantiate the requests_total child so it shows up in Gather()
+
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather() error = %v", err)
+	}
+
+	found := false
+	for _, mf := range mfs {
+		if mf.GetName() == "gobreaker_requests_total" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("Gather() = %v, want to include gobreaker_requests_total", mfs)
+	}
+}
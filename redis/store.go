@@ -0,0 +1,194 @@
+// Package redis provides a gobreaker.Store backed by Redis, letting multiple
+// replicas of a service share one logical circuit breaker for a downstream
+// dependency instead of each tripping independently and hammering a
+// recovering downstream N times harder than intended.
+package redis
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/sony/gobreaker"
+)
+
+// Store 是 gobreaker.Store 基于 Redis 的实现。每个熔断器 name 对应一个 Redis hash，
+// 写操作都通过 Lua 脚本完成，保证 generation/state 的校验与计数更新是原子的；
+// hash 的 TTL 在每次写入时刷新为 ttl，避免长期不活跃的熔断器残留状态占用内存。
+type Store struct {
+	client goredis.Cmdable
+	ctx    context.Context
+	ttl    time.Duration
+}
+
+// NewStore 创建一个基于 client 的 Store。ttl 建议设置为略大于 Settings.Interval/Timeout
+// 中较大值的时长。
+func NewStore(client goredis.Cmdable, ttl time.Duration) *Store {
+	return &Store{client: client, ctx: context.Background(), ttl: ttl}
+}
+
+const (
+	fieldState               = "state"
+	fieldRequests            = "requests"
+	fieldTotalSuccesses      = "total_successes"
+	fieldTotalFailures       = "total_failures"
+	fieldConsecutiveSuccess  = "consecutive_successes"
+	fieldConsecutiveFailures = "consecutive_failures"
+	fieldGeneration          = "generation"
+	fieldExpiry              = "expiry"
+)
+
+func key(name string) string {
+	return "gobreaker:{" + name + "}"
+}
+
+// Load implements gobreaker.Store.
+func (s *Store) Load(name string) (gobreaker.State, gobreaker.Counts, uint64, time.Time, error) {
+	vals, err := s.client.HGetAll(s.ctx, key(name)).Result()
+	if err != nil {
+		return gobreaker.StateClosed, gobreaker.Counts{}, 0, time.Time{}, err
+	}
+	if len(vals) == 0 {
+		return gobreaker.StateClosed, gobreaker.Counts{}, 0, time.Time{}, nil
+	}
+
+	counts := gobreaker.Counts{
+		Requests:             uint32(parseInt(vals[fieldRequests])),
+		TotalSuccesses:       uint32(parseInt(vals[fieldTotalSuccesses])),
+		TotalFailures:        uint32(parseInt(vals[fieldTotalFailures])),
+		ConsecutiveSuccesses: uint32(parseInt(vals[fieldConsecutiveSuccess])),
+		ConsecutiveFailures:  uint32(parseInt(vals[fieldConsecutiveFailures])),
+	}
+	state := gobreaker.State(parseInt(vals[fieldState]))
+	generation := uint64(parseInt(vals[fieldGeneration]))
+	// expiry 字段只有 CompareAndSetState 写过一次状态转移之后才存在；在那之前（hash 只被
+	// IncrementRequest/Success/Failure 写过）vals[fieldExpiry] 是空字符串，不能当成
+	// epoch 0 解析，否则会被 storeCurrentState 的 !expiry.IsZero() 误判成一个早已过期的
+	// Closed 周期，从而在请求中途触发一次不该有的 CompareAndSetState。
+	var expiry time.Time
+	if raw, ok := vals[fieldExpiry]; ok && raw != "" {
+		expiry = time.Unix(0, parseInt(raw))
+	}
+
+	return state, counts, generation, expiry, nil
+}
+
+// incrementScript 原子地校验 generation 是否仍然有效（新 key 视为 generation "0"），对
+// outcome=="request" 额外原子校验准入条件——state=="2"（StateOpen）直接拒绝，
+// state=="1"（StateHalfOpen）且 requests 已达 maxRequests 拒绝——通过校验后再按 outcome
+// 更新对应的计数字段。把准入判断和自增揉进同一个脚本，是为了避免 Go 侧先 HGETALL 读出
+// Requests 判断"还没到 maxRequests"、再单独发一次 increment，这两次 Redis 往返之间的窗口里
+// 多个副本会读到同一份 Requests、一起判断通过、一起把探测请求放给 HalfOpen 正在恢复的下游。
+var incrementScript = goredis.NewScript(`
+local key, generation, outcome, maxRequests, ttl = KEYS[1], ARGV[1], ARGV[2], ARGV[3], ARGV[4]
+
+local current = redis.call("HGET", key, "generation")
+if not current then current = "0" end
+if current ~= generation then
+  return redis.error_reply("generation mismatch")
+end
+
+if outcome == "request" then
+  local state = redis.call("HGET", key, "state")
+  if not state then state = "0" end
+  if state == "2" then
+    return redis.error_reply("breaker open")
+  end
+  if state == "1" then
+    local requests = tonumber(redis.call("HGET", key, "requests") or "0")
+    if requests >= tonumber(maxRequests) then
+      return redis.error_reply("too many requests")
+    end
+  end
+  redis.call("HINCRBY", key, "requests", 1)
+elseif outcome == "success" then
+  redis.call("HINCRBY", key, "total_successes", 1)
+  redis.call("HINCRBY", key, "consecutive_successes", 1)
+  redis.call("HSET", key, "consecutive_failures", 0)
+elseif outcome == "failure" then
+  redis.call("HINCRBY", key, "total_failures", 1)
+  redis.call("HINCRBY", key, "consecutive_failures", 1)
+  redis.call("HSET", key, "consecutive_successes", 0)
+end
+
+redis.call("HSET", key, "generation", generation)
+redis.call("EXPIRE", key, ttl)
+return 1
+`)
+
+func (s *Store) increment(name string, generation uint64, outcome string, maxRequests uint32) error {
+	err := incrementScript.Run(s.ctx, s.client, []string{key(name)},
+		strconv.FormatUint(generation, 10), outcome, int(maxRequests), int(s.ttl.Seconds())).Err()
+	return translateIncrementErr(err)
+}
+
+// translateIncrementErr 把 incrementScript 里准入被拒绝时返回的错误文案（"breaker open"/
+// "too many requests"）翻译成 gobreaker 的哨兵错误，让 CircuitBreaker 不必解析 Store 内部的
+// 错误字符串，就能分辨"准入被原子拒绝，应直接拒绝请求"和"generation 竞争失败，应该重新 Load
+// 后重试"这两种情况；其余错误（包括 generation mismatch）原样返回。
+func translateIncrementErr(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case err.Error() == "breaker open":
+		return gobreaker.ErrOpenState
+	case err.Error() == "too many requests":
+		return gobreaker.ErrTooManyRequests
+	default:
+		return err
+	}
+}
+
+// IncrementRequest implements gobreaker.Store.
+func (s *Store) IncrementRequest(name string, generation uint64, maxRequests uint32) error {
+	return s.increment(name, generation, "request", maxRequests)
+}
+
+// IncrementSuccess implements gobreaker.Store.
+func (s *Store) IncrementSuccess(name string, generation uint64) error {
+	return s.increment(name, generation, "success", 0)
+}
+
+// IncrementFailure implements gobreaker.Store.
+func (s *Store) IncrementFailure(name string, generation uint64) error {
+	return s.increment(name, generation, "failure", 0)
+}
+
+// casScript 原子地校验当前状态是否仍为 from（新 key 视为 StateClosed），是则切到 to，
+// 清空计数、generation 加一、写入新的 expiry；否则返回 error，调用方据此得知状态已经被
+// 别的副本抢先切换。
+var casScript = goredis.NewScript(`
+local key, from, to, expiry, ttl = KEYS[1], ARGV[1], ARGV[2], ARGV[3], ARGV[4]
+
+local current = redis.call("HGET", key, "state")
+if not current then current = "0" end
+if current ~= from then
+  return redis.error_reply("state mismatch")
+end
+
+redis.call("HINCRBY", key, "generation", 1)
+redis.call("HSET", key, "state", to)
+redis.call("HSET", key, "requests", 0)
+redis.call("HSET", key, "total_successes", 0)
+redis.call("HSET", key, "total_failures", 0)
+redis.call("HSET", key, "consecutive_successes", 0)
+redis.call("HSET", key, "consecutive_failures", 0)
+redis.call("HSET", key, "expiry", expiry)
+redis.call("EXPIRE", key, ttl)
+return 1
+`)
+
+// CompareAndSetState implements gobreaker.Store.
+func (s *Store) CompareAndSetState(name string, from, to gobreaker.State, newExpiry time.Time) error {
+	return casScript.Run(s.ctx, s.client, []string{key(name)},
+		strconv.Itoa(int(from)), strconv.Itoa(int(to)), newExpiry.UnixNano(), int(s.ttl.Seconds())).Err()
+}
+
+func parseInt(s string) int64 {
+	if s == "" {
+		return 0
+	}
+	n, _ := strconv.ParseInt(s, 10, 64)
+	return n
+}
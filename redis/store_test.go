@@ -0,0 +1,287 @@
+package redis
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/sony/gobreaker"
+)
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := goredis.NewClient(&goredis.Options{Addr: mr.Addr()})
+	return NewStore(client, time.Minute)
+}
+
+// TestLoadUnknownNameReturnsClosedZeroValue 验证一个从未写入过的 name 被当作初始状态：
+// StateClosed，零值 Counts/generation/expiry。
+func TestLoadUnknownNameReturnsClosedZeroValue(t *testing.T) {
+	s := newTestStore(t)
+
+	state, counts, generation, expiry, err := s.Load("nonexistent")
+	if err != nil {
+		t.Fatalf("Load() error = %v, want nil", err)
+	}
+	if state != gobreaker.StateClosed {
+		t.Fatalf("state = %v, want StateClosed", state)
+	}
+	if counts != (gobreaker.Counts{}) {
+		t.Fatalf("counts = %+v, want zero value", counts)
+	}
+	if generation != 0 {
+		t.Fatalf("generation = %d, want 0", generation)
+	}
+	if !expiry.IsZero() {
+		t.Fatalf("expiry = %v, want zero value", expiry)
+	}
+}
+
+// TestIncrementRequestSuccessFailureRoundTrip 验证 IncrementRequest/Success/Failure 对同一个
+// generation 的写入在 Load 之后能读回正确的计数。
+func TestIncrementRequestSuccessFailureRoundTrip(t *testing.T) {
+	s := newTestStore(t)
+	name := "svc-a"
+
+	if err := s.IncrementRequest(name, 0, 10); err != nil {
+		t.Fatalf("IncrementRequest() error = %v", err)
+	}
+	if err := s.IncrementSuccess(name, 0); err != nil {
+		t.Fatalf("IncrementSuccess() error = %v", err)
+	}
+	if err := s.IncrementRequest(name, 0, 10); err != nil {
+		t.Fatalf("IncrementRequest() error = %v", err)
+	}
+	if err := s.IncrementFailure(name, 0); err != nil {
+		t.Fatalf("IncrementFailure() error = %v", err)
+	}
+
+	_, counts, _, _, err := s.Load(name)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	want := gobreaker.Counts{
+		Requests:             2,
+		TotalSuccesses:       1,
+		TotalFailures:        1,
+		ConsecutiveSuccesses: 0,
+		ConsecutiveFailures:  1,
+	}
+	if counts != want {
+		t.Fatalf("counts = %+v, want %+v", counts, want)
+	}
+}
+
+// TestIncrementRejectsStaleGeneration 验证写操作携带的 generation 一旦落后于 Store 中记录的
+// generation（例如另一个副本已经通过 CompareAndSetState 推进了状态），就返回 error 而不是静默写入。
+func TestIncrementRejectsStaleGeneration(t *testing.T) {
+	s := newTestStore(t)
+	name := "svc-b"
+
+	if err := s.CompareAndSetState(name, gobreaker.StateClosed, gobreaker.StateOpen, time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("CompareAndSetState() error = %v", err)
+	}
+
+	if err := s.IncrementRequest(name, 0, 10); err == nil {
+		t.Fatal("IncrementRequest() with a stale generation should return an error")
+	}
+}
+
+// TestCompareAndSetStateRejectsWrongFrom 验证 CompareAndSetState 只在当前状态等于 from 时才生效，
+// 否则返回 error，让调用方知道状态已经被别的副本抢先切换。
+func TestCompareAndSetStateRejectsWrongFrom(t *testing.T) {
+	s := newTestStore(t)
+	name := "svc-c"
+
+	if err := s.CompareAndSetState(name, gobreaker.StateClosed, gobreaker.StateOpen, time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("first CompareAndSetState() error = %v", err)
+	}
+
+	// 当前状态已经是 Open，再用 from=Closed 切换应该失败
+	if err := s.CompareAndSetState(name, gobreaker.StateClosed, gobreaker.StateHalfOpen, time.Time{}); err == nil {
+		t.Fatal("CompareAndSetState() with a stale from state should return an error")
+	}
+
+	state, counts, generation, _, err := s.Load(name)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if state != gobreaker.StateOpen {
+		t.Fatalf("state = %v, want still StateOpen after the rejected CAS", state)
+	}
+	if generation != 1 {
+		t.Fatalf("generation = %d, want 1 (only the first CAS should have advanced it)", generation)
+	}
+	if counts != (gobreaker.Counts{}) {
+		t.Fatalf("counts = %+v, want cleared by the first CAS", counts)
+	}
+}
+
+// TestIncrementRequestAdmissionIsAtomicUnderConcurrency 验证 HalfOpen 且 maxRequests=1 时，
+// 并发调用 IncrementRequest 里只有一个能拿到"允许通过"，而不是多个副本各自 Load 到同一份
+// Requests=0、都通过准入判断、都各自把探测请求放给正在恢复的下游。
+func TestIncrementRequestAdmissionIsAtomicUnderConcurrency(t *testing.T) {
+	s := newTestStore(t)
+	name := "svc-halfopen-race"
+	if err := s.CompareAndSetState(name, gobreaker.StateClosed, gobreaker.StateHalfOpen, time.Time{}); err != nil {
+		t.Fatalf("CompareAndSetState() error = %v", err)
+	}
+	_, _, generation, _, err := s.Load(name)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	const concurrency = 20
+	var wg sync.WaitGroup
+	results := make(chan error, concurrency)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results <- s.IncrementRequest(name, generation, 1)
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	var admitted, rejected int
+	for err := range results {
+		switch err {
+		case nil:
+			admitted++
+		case gobreaker.ErrTooManyRequests:
+			rejected++
+		default:
+			t.Fatalf("IncrementRequest() unexpected error = %v", err)
+		}
+	}
+	if admitted != 1 {
+		t.Fatalf("admitted = %d, want exactly 1: maxRequests=1 in HalfOpen must let through only one concurrent probe", admitted)
+	}
+	if rejected != concurrency-1 {
+		t.Fatalf("rejected = %d, want %d", rejected, concurrency-1)
+	}
+}
+
+// TestCircuitBreakerHalfOpenAdmitsOnlyMaxRequestsConcurrently 端到端验证：多个副本共享同一个
+// Redis-backed 熔断器时，HalfOpen 期间并发调用 Execute 只会放行 MaxRequests 个探测请求，而不是像
+// 先 Load 再单独 Increment 那样，在两次 Redis 往返之间的窗口里被多个副本一起放行。
+func TestCircuitBreakerHalfOpenAdmitsOnlyMaxRequestsConcurrently(t *testing.T) {
+	s := newTestStore(t)
+	cb := gobreaker.NewCircuitBreaker(gobreaker.Settings{
+		Store:       s,
+		MaxRequests: 1,
+		Timeout:     time.Millisecond,
+		ReadyToTrip: func(counts gobreaker.Counts) bool { return counts.ConsecutiveFailures >= 1 },
+	})
+
+	if _, err := cb.Execute(func() (interface{}, error) { return nil, errBoomRedis }); err != errBoomRedis {
+		t.Fatalf("Execute() error = %v, want %v", err, errBoomRedis)
+	}
+	if got := cb.State(); got != gobreaker.StateOpen {
+		t.Fatalf("state = %v, want Open", got)
+	}
+	time.Sleep(5 * time.Millisecond) // let Timeout elapse so the next calls see HalfOpen
+
+	const concurrency = 20
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	results := make(chan error, concurrency)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := cb.Execute(func() (interface{}, error) {
+				<-release
+				return "ok", nil
+			})
+			results <- err
+		}()
+	}
+	// 给所有 goroutine 一点时间先跑到准入判断，再一起放行请求体，最大化它们在 beforeRequest
+	// 阶段重叠的概率。
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(results)
+
+	var admitted, rejected int
+	for err := range results {
+		switch err {
+		case nil:
+			admitted++
+		case gobreaker.ErrTooManyRequests:
+			rejected++
+		default:
+			t.Fatalf("Execute() unexpected error = %v", err)
+		}
+	}
+	if admitted != 1 {
+		t.Fatalf("admitted = %d, want exactly 1 concurrent HalfOpen probe (MaxRequests=1)", admitted)
+	}
+	if rejected != concurrency-1 {
+		t.Fatalf("rejected = %d, want %d", rejected, concurrency-1)
+	}
+}
+
+// TestCircuitBreakerTripsThroughRedisStore 端到端地验证 CircuitBreaker 在 Settings.Store 指向这个
+// Redis 实现时，能正确地统计失败、跳闸进入 Open，并在超时后探测恢复。
+func TestCircuitBreakerTripsThroughRedisStore(t *testing.T) {
+	s := newTestStore(t)
+	cb := gobreaker.NewCircuitBreaker(gobreaker.Settings{
+		Store:       s,
+		Timeout:     50 * time.Millisecond,
+		ReadyToTrip: func(counts gobreaker.Counts) bool { return counts.ConsecutiveFailures >= 2 },
+	})
+
+	for i := 0; i < 2; i++ {
+		if _, err := cb.Execute(func() (interface{}, error) { return nil, errBoomRedis }); err != errBoomRedis {
+			t.Fatalf("Execute() #%d error = %v, want %v", i, err, errBoomRedis)
+		}
+	}
+
+	if got := cb.State(); got != gobreaker.StateOpen {
+		t.Fatalf("state = %v, want Open after ReadyToTrip", got)
+	}
+
+	if _, err := cb.Execute(func() (interface{}, error) { return nil, nil }); err != gobreaker.ErrOpenState {
+		t.Fatalf("Execute() error = %v, want ErrOpenState while Open", err)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+
+	if _, err := cb.Execute(func() (interface{}, error) { return "ok", nil }); err != nil {
+		t.Fatalf("Execute() error = %v, want nil: the HalfOpen probe should be let through after Timeout", err)
+	}
+	if got := cb.State(); got != gobreaker.StateClosed {
+		t.Fatalf("state = %v, want Closed after a successful HalfOpen probe", got)
+	}
+}
+
+// TestCircuitBreakerFirstRequestNotDroppedWithInterval 验证一个全新的 Redis-backed 熔断器
+// （hash 还没被 CompareAndSetState 写过、Settings.Interval>0）的第一次请求会被正常计数，
+// 而不是被 Load 把缺失的 expiry 字段误解析成 1970 年、触发一次多余的周期重置导致计数被悄悄丢弃。
+func TestCircuitBreakerFirstRequestNotDroppedWithInterval(t *testing.T) {
+	s := newTestStore(t)
+	cb := gobreaker.NewCircuitBreaker(gobreaker.Settings{
+		Store:    s,
+		Interval: time.Minute,
+	})
+
+	if _, err := cb.Execute(func() (interface{}, error) { return "ok", nil }); err != nil {
+		t.Fatalf("Execute() error = %v, want nil", err)
+	}
+
+	if got := cb.Counts().TotalSuccesses; got != 1 {
+		t.Fatalf("TotalSuccesses = %d, want 1: the first request must not be silently dropped", got)
+	}
+}
+
+var errBoomRedis = &storeTestError{"boom"}
+
+type storeTestError struct{ msg string }
+
+func (e *storeTestError) Error() string { return e.msg }
@@ -0,0 +1,121 @@
+package gobreaker
+
+import "sync"
+
+// Registry 持有一组按 name 索引的 CircuitBreaker，方便后台统一创建、枚举和巡检，
+// 避免每个使用方各自维护一份 name -> *CircuitBreaker 的旁表。
+type Registry struct {
+	mutex    sync.Mutex
+	breakers map[string]*CircuitBreaker
+}
+
+// NewRegistry 返回一个空的 Registry。
+func NewRegistry() *Registry {
+	return &Registry{breakers: make(map[string]*CircuitBreaker)}
+}
+
+// GetOrCreate 返回 name 对应的 CircuitBreaker；不存在时用 st 创建一个并登记进 Registry
+// （st.Name 会被强制设为 name）。已经存在时忽略 st，直接返回已登记的实例。
+func (r *Registry) GetOrCreate(name string, st Settings) *CircuitBreaker {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if cb, ok := r.breakers[name]; ok {
+		return cb
+	}
+
+	st.Name = name
+	cb := NewCircuitBreaker(st)
+	r.breakers[name] = cb
+	return cb
+}
+
+// Get 返回 name 对应的 CircuitBreaker，不存在时 ok 为 false。
+func (r *Registry) Get(name string) (cb *CircuitBreaker, ok bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	cb, ok = r.breakers[name]
+	return cb, ok
+}
+
+// Each 遍历 Registry 中登记的所有 CircuitBreaker（遍历顺序不保证），供后台巡检/指标采集使用。
+// fn 返回 false 时提前结束遍历。
+func (r *Registry) Each(fn func(cb *CircuitBreaker) bool) {
+	r.mutex.Lock()
+	breakers := make([]*CircuitBreaker, 0, len(r.breakers))
+	for _, cb := range r.breakers {
+		breakers = append(breakers, cb)
+	}
+	r.mutex.Unlock()
+
+	for _, cb := range breakers {
+		if !fn(cb) {
+			return
+		}
+	}
+}
+
+// Group 把一组子 CircuitBreaker 的状态聚合到一个父 CircuitBreaker 上：当同时处于 Open 状态
+// 的子熔断器数量达到 tripThreshold 时父熔断器也随之 Trip，代表“整个子系统都不健康”。调用方
+// 可以直接用父熔断器的 State()/Execute() 短路掉整个子系统，而不必自己维护一张 *CircuitBreaker
+// 的旁表去逐个检查子熔断器是否都已恢复。
+//
+// Group 只会主动 Trip 父熔断器，不会自动 Reset：Trip/Reset 是 Settings 之外留给运维后台的
+// 手动操作口子，子熔断器仅仅从 Open 探测式地进入 HalfOpen（还没有真正恢复）就不应该清掉
+// 一次操作员手动下发的 Trip，也不应该在多个子熔断器交替探测时反复 Open/Closed 地抖动父
+// 熔断器。父熔断器自己会按正常的 Open->HalfOpen->Closed 流程独立恢复。
+type Group struct {
+	parent        *CircuitBreaker
+	tripThreshold int
+
+	mutex       sync.Mutex
+	openByChild map[string]bool
+}
+
+// NewGroup 创建一个 Group。parent 是聚合用的父熔断器，tripThreshold 是触发父熔断器 Trip 的、
+// 同时处于 Open 状态的子熔断器数量。
+func NewGroup(parent *CircuitBreaker, tripThreshold int) *Group {
+	return &Group{
+		parent:        parent,
+		tripThreshold: tripThreshold,
+		openByChild:   make(map[string]bool),
+	}
+}
+
+// Wrap 返回一个可以直接赋给子熔断器 Settings.OnStateChange 的回调：先调用 next（调用方原有的
+// OnStateChange，可以为 nil），再把这次状态变更计入 Group 的聚合计数，达到 tripThreshold 时
+// Trip 父熔断器（不会 Reset，见 Group 的说明）。典型用法：
+//
+//	childSettings.OnStateChange = group.Wrap(nil)
+func (g *Group) Wrap(next func(name string, from State, to State)) func(name string, from State, to State) {
+	return func(name string, from State, to State) {
+		if next != nil {
+			next(name, from, to)
+		}
+		g.onChildStateChange(name, to)
+	}
+}
+
+func (g *Group) onChildStateChange(name string, to State) {
+	g.mutex.Lock()
+	if to == StateOpen {
+		g.openByChild[name] = true
+	} else {
+		delete(g.openByChild, name)
+	}
+	openCount := len(g.openByChild)
+	g.mutex.Unlock()
+
+	if openCount >= g.tripThreshold {
+		g.parent.Trip()
+	}
+}
+
+// OpenCount 返回当前处于 Open 状态的子熔断器数量，可用于展示“子系统健康度”一类的聚合指标。
+func (g *Group) OpenCount() int {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	return len(g.openByChild)
+}
@@ -0,0 +1,100 @@
+package gobreaker
+
+import "testing"
+
+// TestRegistryGetOrCreateReturnsSameInstanceIgnoringLaterSettings 验证第二次对同一个 name 调用
+// GetOrCreate 会返回第一次创建的同一个实例，而不是用第二次传入的 Settings 重新创建一个。
+func TestRegistryGetOrCreateReturnsSameInstanceIgnoringLaterSettings(t *testing.T) {
+	reg := NewRegistry()
+
+	first := reg.GetOrCreate("svc", Settings{MaxRequests: 1})
+	second := reg.GetOrCreate("svc", Settings{MaxRequests: 99})
+
+	if first != second {
+		t.Fatalf("GetOrCreate() returned a different instance on the second call for the same name")
+	}
+	if second.maxRequests != 1 {
+		t.Fatalf("maxRequests = %d, want 1: the second call's Settings must be ignored once the breaker exists", second.maxRequests)
+	}
+}
+
+// TestRegistryGetReportsMissingName 验证 Get 对一个从未 GetOrCreate 过的 name 返回 ok=false。
+func TestRegistryGetReportsMissingName(t *testing.T) {
+	reg := NewRegistry()
+
+	if cb, ok := reg.Get("nonexistent"); ok || cb != nil {
+		t.Fatalf("Get() = (%v, %v), want (nil, false)", cb, ok)
+	}
+
+	reg.GetOrCreate("svc", Settings{})
+	if cb, ok := reg.Get("svc"); !ok || cb == nil {
+		t.Fatalf("Get() = (%v, %v), want a registered breaker with ok=true", cb, ok)
+	}
+}
+
+// TestRegistryEachVisitsAllAndHonorsEarlyStop 验证 Each 遍历所有已注册的 CircuitBreaker，并且
+// fn 返回 false 时提前结束遍历。
+func TestRegistryEachVisitsAllAndHonorsEarlyStop(t *testing.T) {
+	reg := NewRegistry()
+	reg.GetOrCreate("a", Settings{})
+	reg.GetOrCreate("b", Settings{})
+	reg.GetOrCreate("c", Settings{})
+
+	visited := make(map[string]bool)
+	reg.Each(func(cb *CircuitBreaker) bool {
+		visited[cb.Name()] = true
+		return true
+	})
+	if len(visited) != 3 {
+		t.Fatalf("Each() visited %v, want all 3 registered breakers", visited)
+	}
+
+	var count int
+	reg.Each(func(cb *CircuitBreaker) bool {
+		count++
+		return false
+	})
+	if count != 1 {
+		t.Fatalf("Each() visited %d breakers after fn returned false, want 1", count)
+	}
+}
+
+// TestGroupDoesNotAutoResetManualTrip 验证子熔断器从 Open 探测式地回到 HalfOpen（开启计数降到
+// tripThreshold 以下）时，Group 不会自动 Reset 父熔断器，不能清掉运维手动下发的 Trip。
+func TestGroupDoesNotAutoResetManualTrip(t *testing.T) {
+	parent := NewCircuitBreaker(Settings{Name: "parent"})
+	group := NewGroup(parent, 2)
+
+	group.onChildStateChange("child-a", StateOpen)
+	group.onChildStateChange("child-b", StateOpen)
+	if got := parent.State(); got != StateOpen {
+		t.Fatalf("parent state = %v, want Open once openCount reaches tripThreshold", got)
+	}
+
+	// 运维手动 Trip 之后，一个子熔断器仅仅探测式地从 Open 进入 HalfOpen（openCount 降到阈值
+	// 以下）不应该清掉这次手动 Trip。
+	parent.Trip()
+	group.onChildStateChange("child-a", StateHalfOpen)
+	if got := parent.State(); got != StateOpen {
+		t.Fatalf("parent state = %v, want still Open: a child probing HalfOpen must not auto-Reset a manual Trip", got)
+	}
+}
+
+// TestGroupTripsOnceThresholdReached 验证达到 tripThreshold 才会 Trip 父熔断器，门槛以下不动作。
+func TestGroupTripsOnceThresholdReached(t *testing.T) {
+	parent := NewCircuitBreaker(Settings{Name: "parent"})
+	group := NewGroup(parent, 2)
+
+	group.onChildStateChange("child-a", StateOpen)
+	if got := parent.State(); got != StateClosed {
+		t.Fatalf("parent state = %v, want Closed below tripThreshold", got)
+	}
+	if got := group.OpenCount(); got != 1 {
+		t.Fatalf("OpenCount() = %d, want 1", got)
+	}
+
+	group.onChildStateChange("child-b", StateOpen)
+	if got := parent.State(); got != StateOpen {
+		t.Fatalf("parent state = %v, want Open at tripThreshold", got)
+	}
+}